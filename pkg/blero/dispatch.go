@@ -1,9 +1,31 @@
 package blero
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// retryPollInterval bounds how long a delayed job can sit past its NotBefore time
+// before the dispatcher notices it has become eligible
+const retryPollInterval = 500 * time.Millisecond
+
+// schedulerPollInterval is the fallback wakeup for schedulerLoop when there is no
+// scheduled job to wait on, so newly-added ones are never missed for more than this long
+const schedulerPollInterval = time.Minute
+
+// cancelReason records why an in-flight job's context was canceled, so runJob knows whether
+// to persist a terminal JobCancelled (an explicit Dispatcher.CancelJob) or to requeue the job
+// for another instance to pick up (a Shutdown in progress).
+type cancelReason int
+
+const (
+	cancelShutdown cancelReason = iota
+	cancelExplicit
 )
 
 // Dispatcher struct
@@ -12,8 +34,27 @@ type Dispatcher struct {
 	maxProcessorID int
 	processors     map[int]Processor
 	processing     map[int]uint64
+	cancelFuncs    map[int]context.CancelFunc
+	cancelReasons  map[int]cancelReason
 	ch             chan int
 	quitCh         chan struct{}
+	stopOnce       sync.Once
+	wg             sync.WaitGroup
+	retryPolicy    RetryPolicy
+	queue          *Queue
+	selector       WorkerSelector
+	processorTags  map[int][]string
+	processorTypes map[int][]string
+	limiters       map[int]*rate.Limiter
+	processorStats map[int]*ProcessorStats
+}
+
+// ProcessorStats is a processor's lifetime job throughput, as reported by ProcessorStats.
+// Counts survive UnregisterProcessor, so a pool that was scaled down still shows what it did
+// while it was up.
+type ProcessorStats struct {
+	Completed int64
+	Failed    int64
 }
 
 // NewDispatcher creates new Dispatcher
@@ -21,45 +62,219 @@ func NewDispatcher() *Dispatcher {
 	d := &Dispatcher{}
 	d.processors = make(map[int]Processor)
 	d.processing = make(map[int]uint64)
+	d.cancelFuncs = make(map[int]context.CancelFunc)
+	d.cancelReasons = make(map[int]cancelReason)
+	d.processorTags = make(map[int][]string)
+	d.processorTypes = make(map[int][]string)
+	d.limiters = make(map[int]*rate.Limiter)
+	d.processorStats = make(map[int]*ProcessorStats)
 	d.ch = make(chan int, 100)
 	d.quitCh = make(chan struct{})
+	d.retryPolicy = DefaultRetryPolicy
 	return d
 }
 
-// StartLoop starts the dispatcher assignment loop
+// ProcessorStats returns a snapshot of every processor's lifetime completed/failed job counts,
+// for GET /stats and GET /metrics per-processor throughput.
+func (d *Dispatcher) ProcessorStats() map[int]ProcessorStats {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	out := make(map[int]ProcessorStats, len(d.processorStats))
+	for pID, st := range d.processorStats {
+		out[pID] = *st
+	}
+	return out
+}
+
+// recordOutcome tallies a completed or failed job against pID's lifetime ProcessorStats
+func (d *Dispatcher) recordOutcome(pID int, failed bool) {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	st, ok := d.processorStats[pID]
+	if !ok {
+		st = &ProcessorStats{}
+		d.processorStats[pID] = st
+	}
+	if failed {
+		st.Failed++
+	} else {
+		st.Completed++
+	}
+}
+
+// SetRetryPolicy overrides the default RetryPolicy applied to jobs whose Job.MaxRetries is unset
+func (d *Dispatcher) SetRetryPolicy(rp RetryPolicy) {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	d.retryPolicy = rp
+}
+
+// StartLoop starts the dispatcher assignment loop and the scheduler that promotes
+// scheduled/delayed jobs once they become due
 func (d *Dispatcher) StartLoop(q *Queue) {
-	go func() {
-		for {
-			select {
-			case <-d.ch:
-				err := d.assignJobs(q)
-				if err != nil {
-					fmt.Fprintf(os.Stderr, "Cannot assign jobs: %v", err)
-				}
-			case <-d.quitCh: // loop was stopped
-				return
+	d.queue = q
+
+	go d.assignLoop(q)
+	go d.schedulerLoop(q)
+}
+
+// assignLoop assigns pending jobs to free processors whenever a processor frees up,
+// a processor is registered, or the periodic ticker fires to catch delayed/retried jobs
+func (d *Dispatcher) assignLoop(q *Queue) {
+	ticker := time.NewTicker(retryPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.ch:
+			err := d.assignJobs(q)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot assign jobs: %v", err)
+			}
+		case <-ticker.C: // wake up periodically to pick up delayed/retried jobs
+			err := d.assignJobs(q)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot assign jobs: %v", err)
+			}
+		case <-d.quitCh: // loop was stopped
+			return
+		}
+	}
+}
+
+// schedulerLoop sleeps until the earliest scheduled job's runAt, then promotes all due
+// scheduled jobs into the pending bucket and signals the assignment loop. It recomputes
+// its wakeup every time it fires, so it stays aligned with whatever was just enqueued.
+func (d *Dispatcher) schedulerLoop(q *Queue) {
+	timer := time.NewTimer(schedulerPollInterval)
+	defer timer.Stop()
+
+	for {
+		wait := schedulerPollInterval
+		next, ok, err := q.nextScheduledAt()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read next scheduled job: %v", err)
+		} else if ok {
+			if until := time.Until(next); until < wait {
+				wait = until
+			}
+			if wait < 0 {
+				wait = 0
 			}
 		}
+		timer.Reset(wait)
+
+		select {
+		case <-timer.C:
+			n, err := q.promoteDueScheduledJobs()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot promote scheduled jobs: %v", err)
+				continue
+			}
+			if n > 0 {
+				d.signal()
+			}
+		case <-d.quitCh:
+			return
+		}
+	}
+}
+
+// signal wakes up the assignment loop without blocking the caller
+func (d *Dispatcher) signal() {
+	go func() {
+		d.ch <- 1
 	}()
 }
 
-// StopLoop stops the dispatcher assignment loop
+// StopLoop stops the dispatcher assignment loop. It does not wait for in-flight jobs to
+// finish or cancel them; use Shutdown for a graceful stop.
 func (d *Dispatcher) StopLoop() {
-	close(d.quitCh)
+	d.stopOnce.Do(func() {
+		close(d.quitCh)
+	})
+}
+
+// Shutdown stops the assignment loop, cancels every in-flight job's context and waits for
+// them to return. If ctx expires first, any job still running is reset to pending in the
+// queue so another Dispatcher instance can pick it up on restart.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.StopLoop()
+
+	d.dispatchL.Lock()
+	for pID, cancel := range d.cancelFuncs {
+		if _, ok := d.cancelReasons[pID]; !ok {
+			d.cancelReasons[pID] = cancelShutdown
+		}
+		cancel()
+	}
+	d.dispatchL.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		d.dispatchL.Lock()
+		unfinished := make([]uint64, 0, len(d.processing))
+		for _, jobID := range d.processing {
+			unfinished = append(unfinished, jobID)
+		}
+		d.dispatchL.Unlock()
+
+		for _, jobID := range unfinished {
+			if err := d.queue.requeueJob(jobID); err != nil {
+				fmt.Fprintf(os.Stderr, "Cannot requeue job %v on shutdown: %v", jobID, err)
+			}
+		}
+
+		return ctx.Err()
+	}
+}
+
+// CancelJob stops a specific running job: its processor's context is canceled and, once it
+// returns, runJob persists it as JobCancelled rather than requeuing it for another attempt.
+// It is a no-op if the job is not currently running.
+func (d *Dispatcher) CancelJob(jobID uint64) {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	for pID, id := range d.processing {
+		if id == jobID {
+			d.cancelReasons[pID] = cancelExplicit
+			if cancel, ok := d.cancelFuncs[pID]; ok {
+				cancel()
+			}
+			return
+		}
+	}
 }
 
 // RegisterProcessor registers a new processor
 func (d *Dispatcher) RegisterProcessor(p Processor) int {
+	return d.RegisterProcessorWithTags(p, nil)
+}
+
+// RegisterProcessorWithTags registers a new processor along with capability tags a
+// WorkerSelector can use to decide whether this processor may handle a given job
+func (d *Dispatcher) RegisterProcessorWithTags(p Processor, tags []string) int {
 	d.dispatchL.Lock()
 	defer d.dispatchL.Unlock()
 
 	d.maxProcessorID++
 	d.processors[d.maxProcessorID] = p
+	d.processorTags[d.maxProcessorID] = tags
 
-	go func() {
-		// signal that the processor is now available
-		d.ch <- 1
-	}()
+	// signal that the processor is now available
+	d.signal()
 
 	return d.maxProcessorID
 }
@@ -71,23 +286,84 @@ func (d *Dispatcher) UnregisterProcessor(pID int) {
 	defer d.dispatchL.Unlock()
 
 	delete(d.processors, pID)
+	delete(d.processorTags, pID)
+	delete(d.processorTypes, pID)
+	delete(d.limiters, pID)
 }
 
-// assignJobs assigns pending jobs from the queue to free processors
+// assignJobs assigns pending jobs from the queue to free processors. With no WorkerSelector
+// installed this is "first free processor wins"; with one installed, jobs are matched to
+// the best available processor per the selector's Ok/Cmp.
 func (d *Dispatcher) assignJobs(q *Queue) error {
 	d.dispatchL.Lock()
 	defer d.dispatchL.Unlock()
 
-	for pID := range d.processors {
-		if _, ok := d.processing[pID]; !ok {
-			err := d.assignJob(q, pID)
+	if d.selector == nil {
+		for pID := range d.processors {
+			if _, ok := d.processing[pID]; !ok {
+				if err := d.assignJob(q, pID); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for {
+		var free []int
+		for pID := range d.processors {
+			if _, ok := d.processing[pID]; !ok {
+				free = append(free, pID)
+			}
+		}
+		if len(free) == 0 {
+			return nil
+		}
+
+		jobs, err := q.peekPendingJobs()
+		if err != nil {
+			return err
+		}
+
+		// Walk pending jobs in priority order rather than stopping at the first one no free
+		// processor can handle: a lower-priority job further back may be the only one any
+		// currently-free processor actually accepts, and it shouldn't starve behind a job
+		// nothing free can run.
+		assigned := false
+		for _, j := range jobs {
+			// only consider processors whose RegisterProcessorPool JobTypes (if any) accept
+			// j, so the candidate bestProcessor picks is guaranteed to be one
+			// assignSpecificJob can actually dequeue j for
+			var candidates []int
+			for _, pID := range free {
+				if matchesType(j.Type, d.processorTypes[pID]) {
+					candidates = append(candidates, pID)
+				}
+			}
+			if len(candidates) == 0 {
+				continue
+			}
+
+			pID, err := d.bestProcessor(j, candidates)
 			if err != nil {
 				return err
 			}
+			if pID == 0 {
+				continue
+			}
+
+			if err := d.assignSpecificJob(q, pID, j.ID); err != nil {
+				return err
+			}
+			assigned = true
+			break
 		}
-	}
 
-	return nil
+		if !assigned {
+			return nil
+		}
+	}
 }
 
 // assignJob assigns a pending job processor #pID and starts the run
@@ -98,7 +374,7 @@ func (d *Dispatcher) assignJob(q *Queue, pID int) error {
 		return fmt.Errorf("Processor %v not found", pID)
 	}
 
-	j, err := q.dequeueJob()
+	j, err := q.dequeueJobOfType(d.processorTypes[pID])
 	if err != nil {
 		return err
 	}
@@ -107,14 +383,66 @@ func (d *Dispatcher) assignJob(q *Queue, pID int) error {
 		return nil
 	}
 
+	return d.startJob(q, pID, p, j)
+}
+
+// assignSpecificJob assigns a specific pending job, already chosen by assignJobs' selector
+// branch, to processor #pID. Used instead of assignJob there because that branch walks past
+// jobs no free processor can handle, so by the time it picks a (job, processor) pair it must
+// dequeue exactly that job rather than whichever one dequeueJobOfType would return first.
+// NOT THREAD SAFE !! only call from assignJobs
+func (d *Dispatcher) assignSpecificJob(q *Queue, pID int, jobID uint64) error {
+	p := d.processors[pID]
+	if p == nil {
+		return fmt.Errorf("Processor %v not found", pID)
+	}
+
+	j, err := q.dequeueJobByID(jobID)
+	if err != nil {
+		return err
+	}
+	// claimed by a concurrent dequeue (e.g. a RemoteProcessor's /jobs/next) between peek and
+	// assign
+	if j == nil {
+		return nil
+	}
+
+	return d.startJob(q, pID, p, j)
+}
+
+// startJob applies pID's rate limit, if any, requeuing j and scheduling a retry if the
+// reservation isn't immediately satisfiable; otherwise it starts j running on p.
+// NOT THREAD SAFE !! only call from assignJobs
+func (d *Dispatcher) startJob(q *Queue, pID int, p Processor, j *Job) error {
+	if limiter, ok := d.limiters[pID]; ok {
+		res := limiter.Reserve()
+		if !res.OK() {
+			res.Cancel()
+			return fmt.Errorf("rate limit for processor %v cannot ever be satisfied for job %v", pID, j.ID)
+		}
+
+		if delay := res.Delay(); delay > 0 {
+			res.Cancel()
+			if rerr := q.requeueJob(j.ID); rerr != nil {
+				return fmt.Errorf("cannot requeue rate-limited job %v: %v", j.ID, rerr)
+			}
+			time.AfterFunc(delay, d.signal)
+			return nil
+		}
+	}
+
 	fmt.Printf("Assigning job %v to processor %v\n", j.ID, pID)
 
 	if _, ok := d.processing[pID]; ok {
 		return fmt.Errorf("Cannot assign job %v to Processor %v. Processor busy with %v", j.ID, pID, d.processing[pID])
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	d.processing[pID] = j.ID
-	go d.runJob(q, pID, p, j)
+	d.cancelFuncs[pID] = cancel
+
+	d.wg.Add(1)
+	go d.runJob(ctx, q, pID, p, j)
 
 	return nil
 }
@@ -125,32 +453,59 @@ func (d *Dispatcher) unassignJob(pID int) {
 	defer d.dispatchL.Unlock()
 
 	delete(d.processing, pID)
+	delete(d.cancelFuncs, pID)
+	delete(d.cancelReasons, pID)
 }
 
 // runJob runs a job on the corresponding processor and moves it to the right queue depending on results
-func (d *Dispatcher) runJob(q *Queue, pID int, p Processor, j *Job) {
+func (d *Dispatcher) runJob(ctx context.Context, q *Queue, pID int, p Processor, j *Job) {
+	defer d.wg.Done()
 	defer d.processorDone(pID)
-	err := p.Run(j)
+
+	err := p.Run(ctx, j)
 	if err != nil {
+		// the job was interrupted rather than genuinely failing: an explicit CancelJob is
+		// terminal, while a Shutdown-triggered interrupt is requeued for another instance
+		if ctx.Err() != nil {
+			d.dispatchL.Lock()
+			reason := d.cancelReasons[pID]
+			d.dispatchL.Unlock()
+
+			if reason == cancelExplicit {
+				if cerr := q.markJobCancelled(j.ID); cerr != nil {
+					fmt.Printf("markJobCancelled -> %v failed: %v\n", j.ID, cerr)
+				}
+				return
+			}
+
+			if rerr := q.requeueJob(j.ID); rerr != nil {
+				fmt.Printf("requeueJob -> %v failed: %v\n", j.ID, rerr)
+			}
+			return
+		}
+
 		fmt.Printf("Processor: %v. Job %v failed with err: %v\n", pID, j.ID, err)
-		err := q.markJobDone(j.ID, JobFailed)
-		if err != nil {
-			fmt.Printf("markJobDone -> %v JobFailed failed: %v\n", j.ID, err)
+
+		d.dispatchL.Lock()
+		rp := d.retryPolicy
+		d.dispatchL.Unlock()
+
+		if ferr := q.FailJob(j, err, rp); ferr != nil {
+			fmt.Printf("FailJob -> %v failed: %v\n", j.ID, ferr)
 		}
+		d.recordOutcome(pID, true)
 		return
 	}
 
-	err = q.markJobDone(j.ID, JobComplete)
-	if err != nil {
-		fmt.Printf("markJobDone -> %v JobComplete failed: %v\n", j.ID, err)
+	if cerr := q.CompleteJob(j.ID); cerr != nil {
+		fmt.Printf("CompleteJob -> %v failed: %v\n", j.ID, cerr)
 	}
+	d.recordOutcome(pID, false)
 }
 
 func (d *Dispatcher) processorDone(pID int) {
 	d.unassignJob(pID)
 
-	go func() {
-		// signal that the processor might now be available
-		d.ch <- 1
-	}()
+	// signal that the processor might now be available
+	d.signal()
 }
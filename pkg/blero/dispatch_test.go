@@ -0,0 +1,362 @@
+package blero
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type noopProcessor struct{}
+
+func (noopProcessor) Run(ctx context.Context, j *Job) error { return nil }
+
+// permissiveSelector accepts every processor and never prefers one over another, so any
+// starvation in assignJobs must come from JobTypes filtering, not from the selector itself.
+type permissiveSelector struct{}
+
+func (permissiveSelector) Ok(j *Job, p Processor) (bool, error)     { return true, nil }
+func (permissiveSelector) Cmp(j *Job, a, b Processor) (bool, error) { return false, nil }
+
+// blockingProcessor runs until its context is canceled, then returns ctx.Err()
+type blockingProcessor struct{}
+
+func (blockingProcessor) Run(ctx context.Context, j *Job) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// sleepyProcessor takes delay to run regardless of ctx, then succeeds. It models a job that
+// finishes on its own shortly after a Shutdown is requested, within the grace period.
+type sleepyProcessor struct{ delay time.Duration }
+
+func (s sleepyProcessor) Run(ctx context.Context, j *Job) error {
+	time.Sleep(s.delay)
+	return nil
+}
+
+// stubbornProcessor ignores ctx cancellation for delay before returning ctx.Err(). It models
+// a job that is still running once a Shutdown's grace period has already expired.
+type stubbornProcessor struct{ delay time.Duration }
+
+func (s stubbornProcessor) Run(ctx context.Context, j *Job) error {
+	time.Sleep(s.delay)
+	return ctx.Err()
+}
+
+// waitForState polls until j reaches state or the attempts are exhausted
+func waitForState(t *testing.T, q *Queue, jobID uint64, state JobState) *Job {
+	t.Helper()
+
+	var j *Job
+	var err error
+	for i := 0; i < 200; i++ {
+		j, err = q.GetJob(jobID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if j.State == state {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("job %v never reached state %v, last seen %v", jobID, state, j.State)
+	return nil
+}
+
+func TestShutdownWaitsForInFlightJobsThenReturnsNil(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	d := NewDispatcher()
+	d.StartLoop(q)
+
+	d.RegisterProcessor(sleepyProcessor{delay: 50 * time.Millisecond})
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	waitForState(t, q, j.ID, JobRunning)
+
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	got, err := q.GetJob(j.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.State != JobComplete {
+		t.Fatalf("expected job to finish and reach JobComplete during the graceful drain, got %v", got.State)
+	}
+}
+
+func TestShutdownRequeuesUnfinishedJobOnCtxExpiry(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	d := NewDispatcher()
+	d.StartLoop(q)
+
+	d.RegisterProcessor(stubbornProcessor{delay: 300 * time.Millisecond})
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	waitForState(t, q, j.ID, JobRunning)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	err = d.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Shutdown to report ctx expiry, got %v", err)
+	}
+
+	got, err := q.GetJob(j.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.State != JobPending {
+		t.Fatalf("expected the still-running job to be requeued to JobPending, got %v", got.State)
+	}
+	if !got.NotBefore.IsZero() {
+		t.Fatalf("expected requeueJob to clear NotBefore, got %v", got.NotBefore)
+	}
+
+	// let stubbornProcessor's goroutine finish before the queue is closed
+	time.Sleep(350 * time.Millisecond)
+}
+
+func TestCancelJobPersistsJobCancelledNotRequeued(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	d := NewDispatcher()
+	d.StartLoop(q)
+	defer d.StopLoop()
+
+	d.RegisterProcessor(blockingProcessor{})
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	var running *Job
+	for i := 0; i < 100; i++ {
+		running, err = q.GetJob(j.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if running.State == JobRunning {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if running.State != JobRunning {
+		t.Fatalf("expected job to reach JobRunning, got state %v", running.State)
+	}
+
+	d.CancelJob(j.ID)
+
+	var final *Job
+	for i := 0; i < 100; i++ {
+		final, err = q.GetJob(j.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if final.State == JobCancelled {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if final.State != JobCancelled {
+		t.Fatalf("expected explicitly-cancelled job to end up JobCancelled, got %v", final.State)
+	}
+}
+
+// failingProcessor always returns err
+type failingProcessor struct{ err error }
+
+func (f failingProcessor) Run(ctx context.Context, j *Job) error { return f.err }
+
+func TestProcessorStatsTracksCompletionsAndFailures(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	d := NewDispatcher()
+	d.SetRetryPolicy(RetryPolicy{MaxRetries: 0}) // fail straight to JobDead, no retry delay to wait out
+	d.StartLoop(q)
+	defer d.StopLoop()
+
+	// run the two jobs one at a time, rather than registering both processors up front, so
+	// their state-count updates never race each other inside badger
+	okID := d.RegisterProcessor(noopProcessor{})
+	okJob, err := q.EnqueueJob([]byte("ok"))
+	if err != nil {
+		t.Fatalf("EnqueueJob(ok): %v", err)
+	}
+	waitForState(t, q, okJob.ID, JobComplete)
+
+	failID := d.RegisterProcessor(failingProcessor{err: errors.New("boom")})
+	d.UnregisterProcessor(okID)
+	failJob, err := q.EnqueueJob([]byte("fail"))
+	if err != nil {
+		t.Fatalf("EnqueueJob(fail): %v", err)
+	}
+	waitForState(t, q, failJob.ID, JobDead)
+
+	stats := d.ProcessorStats()
+	if got := stats[okID]; got.Completed != 1 || got.Failed != 0 {
+		t.Fatalf("expected processor %d to show 1 completed/0 failed, got %+v", okID, got)
+	}
+	if got := stats[failID]; got.Failed != 1 || got.Completed != 0 {
+		t.Fatalf("expected processor %d to show 0 completed/1 failed, got %+v", failID, got)
+	}
+}
+
+func TestRegisterProcessorPoolSharesLimiterAndJobTypes(t *testing.T) {
+	d := NewDispatcher()
+
+	ids := d.RegisterProcessorPool(noopProcessor{}, PoolOptions{
+		Concurrency: 3,
+		RateLimit:   10,
+		JobTypes:    []string{"email"},
+	})
+	if len(ids) != 3 {
+		t.Fatalf("expected 3 processor IDs, got %d", len(ids))
+	}
+
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	var limiter *rate.Limiter
+	for _, pID := range ids {
+		if types := d.processorTypes[pID]; len(types) != 1 || types[0] != "email" {
+			t.Fatalf("processor %d: expected JobTypes [email], got %v", pID, types)
+		}
+
+		l, ok := d.limiters[pID]
+		if !ok {
+			t.Fatalf("processor %d: expected a rate limiter to be registered", pID)
+		}
+		if limiter == nil {
+			limiter = l
+		} else if l != limiter {
+			t.Fatalf("processor %d: expected every pool member to share the same *rate.Limiter", pID)
+		}
+	}
+}
+
+func TestAssignJobsSelectorWithJobTypesDoesNotDeadlock(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	d := NewDispatcher()
+	d.SetSelector(permissiveSelector{})
+	// the pool only accepts "gpu" jobs, but we enqueue a "default" one below
+	d.RegisterProcessorPool(noopProcessor{}, PoolOptions{Concurrency: 2, JobTypes: []string{"gpu"}})
+
+	if _, err := q.EnqueueJobWithOptions([]byte("payload"), JobOptions{Type: "default"}); err != nil {
+		t.Fatalf("EnqueueJobWithOptions: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.assignJobs(q) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("assignJobs returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("assignJobs deadlocked matching a job against a selector+JobTypes mismatch")
+	}
+
+	jobs, err := q.ListJobs(JobPending, 10, 0)
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	if len(jobs) != 1 {
+		t.Fatalf("expected the unmatched job to remain pending, got %d pending jobs", len(jobs))
+	}
+}
+
+// TestAssignJobsSelectorSkipsPastUnmatchableHeadJob reproduces a starvation regression: with a
+// WorkerSelector installed, a high-priority job that matches no free processor used to make
+// assignJobs give up entirely, leaving a free, eligible processor idle even though a
+// lower-priority job behind the head matched it perfectly.
+func TestAssignJobsSelectorSkipsPastUnmatchableHeadJob(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	d := NewDispatcher()
+	d.SetSelector(permissiveSelector{})
+	d.RegisterProcessorPool(noopProcessor{}, PoolOptions{Concurrency: 1, JobTypes: []string{"gpu"}})
+	d.RegisterProcessorPool(noopProcessor{}, PoolOptions{Concurrency: 1, JobTypes: []string{"cpu"}})
+
+	// enqueued ahead of, and higher priority than, the cpu job below, but matches neither pool
+	if _, err := q.EnqueueJobWithOptions([]byte("unmatchable"), JobOptions{Type: "none", Priority: 10}); err != nil {
+		t.Fatalf("EnqueueJobWithOptions(none): %v", err)
+	}
+	cpuJob, err := q.EnqueueJobWithOptions([]byte("cpu work"), JobOptions{Type: "cpu", Priority: 1})
+	if err != nil {
+		t.Fatalf("EnqueueJobWithOptions(cpu): %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.assignJobs(q) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("assignJobs returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("assignJobs deadlocked")
+	}
+
+	// noopProcessor completes instantly, so by now the cpu job may already be JobComplete;
+	// what matters is that it was dequeued at all rather than left starving behind the head
+	got, err := q.GetJob(cpuJob.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.State == JobPending {
+		t.Fatalf("expected the cpu job to be assigned to the free cpu processor, still JobPending")
+	}
+
+	jobs, err := q.ListJobs(JobPending, 10, 0)
+	if err != nil {
+		t.Fatalf("ListJobs: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].Type != "none" {
+		t.Fatalf("expected only the unmatchable job to remain pending, got %v", jobs)
+	}
+}
@@ -0,0 +1,77 @@
+package blero
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobState represents the state of a Job in its lifecycle
+type JobState int
+
+const (
+	// JobPending means the job is waiting to be picked up by a processor
+	JobPending JobState = iota
+	// JobComplete means the job ran successfully
+	JobComplete
+	// JobFailed means the job ran and returned an error
+	JobFailed
+	// JobDead means the job exhausted its retries and was moved to the dead-letter bucket
+	JobDead
+	// JobScheduled means the job is waiting in the scheduled bucket for its runAt to pass
+	JobScheduled
+	// JobCancelled means the job was removed from the pending/scheduled bucket before it ran,
+	// or was explicitly cancelled while running
+	JobCancelled
+	// JobRunning means the job has been dequeued and is currently being run by a processor
+	JobRunning
+)
+
+// Job represents a unit of work stored in the Queue
+type Job struct {
+	ID        uint64
+	Data      []byte
+	Priority  int
+	CreatedAt time.Time
+	State     JobState
+
+	// NotBefore, when in the future, makes the job ineligible for dequeue until it passes
+	NotBefore time.Time
+	// Attempt counts how many times this job has been run, starting at 0
+	Attempt int
+	// MaxRetries caps how many times a failed job is retried before moving to the dead-letter bucket.
+	// Zero means the Dispatcher's default RetryPolicy applies.
+	MaxRetries int
+	// Type optionally classifies the job, e.g. for RegisterProcessorPool's JobTypes filter.
+	// Empty matches any processor pool that doesn't restrict JobTypes.
+	Type string
+}
+
+// DefaultPriority is used when a job is enqueued without an explicit priority
+const DefaultPriority = 0
+
+// JobOptions customizes how a job is enqueued
+type JobOptions struct {
+	// Priority controls ordering among pending jobs: higher values are dequeued first
+	Priority int
+	// Delay, if set, makes the job eligible for dequeue only after it elapses
+	Delay time.Duration
+	// MaxRetries, if set, overrides the queue's default retry policy for this job
+	MaxRetries int
+	// Type optionally classifies the job, e.g. for RegisterProcessorPool's JobTypes filter
+	Type string
+}
+
+// encodeJob serializes a Job for storage
+func encodeJob(j *Job) ([]byte, error) {
+	return json.Marshal(j)
+}
+
+// decodeJob deserializes a Job previously written by encodeJob
+func decodeJob(data []byte) (*Job, error) {
+	j := &Job{}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
@@ -0,0 +1,55 @@
+package blero
+
+import "golang.org/x/time/rate"
+
+// PoolOptions configures a pool of processors registered together via RegisterProcessorPool
+type PoolOptions struct {
+	// Concurrency is how many copies of p to register, i.e. how many jobs the pool can run
+	// at once. Defaults to 1.
+	Concurrency int
+	// RateLimit caps the steady-state rate, across the whole pool, at which jobs are
+	// dispatched to p. Zero means unlimited.
+	RateLimit rate.Limit
+	// Burst is how many jobs can be dispatched back-to-back before RateLimit kicks in.
+	// Defaults to 1 when RateLimit is set.
+	Burst int
+	// JobTypes restricts the pool to jobs whose Job.Type is in this list. Empty means the
+	// pool accepts jobs of any type.
+	JobTypes []string
+}
+
+// RegisterProcessorPool registers Concurrency copies of p that share a single rate limiter
+// and JobTypes filter, protecting a downstream resource (e.g. "max 10 webhook deliveries/sec
+// across all workers") without the caller having to hand-roll the throttling. It returns the
+// processor ID of each copy.
+func (d *Dispatcher) RegisterProcessorPool(p Processor, opts PoolOptions) []int {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var limiter *rate.Limiter
+	if opts.RateLimit > 0 {
+		burst := opts.Burst
+		if burst < 1 {
+			burst = 1
+		}
+		limiter = rate.NewLimiter(opts.RateLimit, burst)
+	}
+
+	ids := make([]int, 0, concurrency)
+	for i := 0; i < concurrency; i++ {
+		pID := d.RegisterProcessorWithTags(p, nil)
+
+		d.dispatchL.Lock()
+		d.processorTypes[pID] = opts.JobTypes
+		if limiter != nil {
+			d.limiters[pID] = limiter
+		}
+		d.dispatchL.Unlock()
+
+		ids = append(ids, pID)
+	}
+
+	return ids
+}
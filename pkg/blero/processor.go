@@ -0,0 +1,10 @@
+package blero
+
+import "context"
+
+// Processor runs a Job and reports success or failure via the returned error.
+// Implementations should return promptly when ctx is canceled so the Dispatcher
+// can shut down or reassign the job.
+type Processor interface {
+	Run(ctx context.Context, j *Job) error
+}
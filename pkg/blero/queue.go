@@ -0,0 +1,885 @@
+package blero
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/dgraph-io/badger/v3"
+)
+
+const (
+	pendingPrefix = "pending|"
+	jobPrefix     = "job|"
+	deadPrefix    = "dead|"
+	schedPrefix   = "sched|"
+	countPrefix   = "count|"
+)
+
+// Queue stores jobs in a BadgerDB instance
+type Queue struct {
+	db *badger.DB
+}
+
+// NewQueue opens (or creates) a Queue backed by a BadgerDB database at path
+func NewQueue(path string) (*Queue, error) {
+	db, err := badger.Open(badger.DefaultOptions(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot open badger db: %v", err)
+	}
+
+	return &Queue{db: db}, nil
+}
+
+// Close closes the underlying database
+func (q *Queue) Close() error {
+	return q.db.Close()
+}
+
+// EnqueueJob adds a new job to the queue with the default priority
+func (q *Queue) EnqueueJob(data []byte) (*Job, error) {
+	return q.EnqueueJobWithOptions(data, JobOptions{Priority: DefaultPriority})
+}
+
+// EnqueueJobWithOptions adds a new job to the queue honoring the given options
+func (q *Queue) EnqueueJobWithOptions(data []byte, opts JobOptions) (*Job, error) {
+	now := time.Now()
+	j := &Job{
+		Data:       data,
+		Priority:   opts.Priority,
+		CreatedAt:  now,
+		State:      JobPending,
+		NotBefore:  now.Add(opts.Delay),
+		MaxRetries: opts.MaxRetries,
+		Type:       opts.Type,
+	}
+
+	err := q.db.Update(func(txn *badger.Txn) error {
+		id, err := q.db.GetSequence([]byte("job-seq"), 1)
+		if err != nil {
+			return err
+		}
+		defer id.Release()
+
+		next, err := id.Next()
+		if err != nil {
+			return err
+		}
+		j.ID = next
+
+		return q.putJob(txn, j, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot enqueue job: %v", err)
+	}
+
+	return j, nil
+}
+
+// putJob writes the job record, its bucket index entry and adjusts the per-state counters
+// StateCount reads from. oldState is the job's state before this write, or nil if the job is
+// being created for the first time.
+func (q *Queue) putJob(txn *badger.Txn, j *Job, oldState *JobState) error {
+	data, err := encodeJob(j)
+	if err != nil {
+		return err
+	}
+
+	if err := txn.Set(jobKey(j.ID), data); err != nil {
+		return err
+	}
+
+	if oldState == nil || *oldState != j.State {
+		if oldState != nil {
+			if err := q.adjustStateCount(txn, *oldState, -1); err != nil {
+				return err
+			}
+		}
+		if err := q.adjustStateCount(txn, j.State, 1); err != nil {
+			return err
+		}
+	}
+
+	if j.State == JobPending {
+		return txn.Set(pendingKey(j.Priority, j.CreatedAt, j.ID), []byte{})
+	}
+
+	if j.State == JobDead {
+		return txn.Set(deadKey(j.CreatedAt, j.ID), []byte{})
+	}
+
+	if j.State == JobScheduled {
+		return txn.Set(schedKey(j.NotBefore, j.ID), []byte{})
+	}
+
+	return nil
+}
+
+// stateCountKey encodes the key under which StateCount's running total for state is stored
+func stateCountKey(state JobState) []byte {
+	key := make([]byte, 0, len(countPrefix)+8)
+	key = append(key, []byte(countPrefix)...)
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(state))
+	return append(key, buf[:]...)
+}
+
+// adjustStateCount adds delta to the persisted running total of jobs in state, within txn
+func (q *Queue) adjustStateCount(txn *badger.Txn, state JobState, delta int64) error {
+	key := stateCountKey(state)
+
+	var count int64
+	item, err := txn.Get(key)
+	switch {
+	case err == badger.ErrKeyNotFound:
+		// no jobs have ever been in this state; count stays 0
+	case err != nil:
+		return err
+	default:
+		if err := item.Value(func(val []byte) error {
+			count = int64(binary.BigEndian.Uint64(val))
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	count += delta
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(count))
+	return txn.Set(key, buf[:])
+}
+
+// StateCount returns the number of jobs currently in state in O(1) time, regardless of the
+// total job count. Used by stats()/the /metrics endpoint instead of ListJobs, which would
+// otherwise require a full keyspace scan on every Prometheus scrape.
+func (q *Queue) StateCount(state JobState) (int64, error) {
+	var count int64
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(stateCountKey(state))
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			count = int64(binary.BigEndian.Uint64(val))
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot read state count: %v", err)
+	}
+
+	return count, nil
+}
+
+// EnqueueJobAt stores a job in the scheduled bucket, to be promoted to pending once runAt passes
+func (q *Queue) EnqueueJobAt(data []byte, runAt time.Time) (*Job, error) {
+	now := time.Now()
+	j := &Job{
+		Data:      data,
+		Priority:  DefaultPriority,
+		CreatedAt: now,
+		State:     JobScheduled,
+		NotBefore: runAt,
+	}
+
+	err := q.db.Update(func(txn *badger.Txn) error {
+		id, err := q.db.GetSequence([]byte("job-seq"), 1)
+		if err != nil {
+			return err
+		}
+		defer id.Release()
+
+		next, err := id.Next()
+		if err != nil {
+			return err
+		}
+		j.ID = next
+
+		return q.putJob(txn, j, nil)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot enqueue scheduled job: %v", err)
+	}
+
+	return j, nil
+}
+
+// EnqueueJobIn is a convenience wrapper around EnqueueJobAt for relative delays
+func (q *Queue) EnqueueJobIn(data []byte, delay time.Duration) (*Job, error) {
+	return q.EnqueueJobAt(data, time.Now().Add(delay))
+}
+
+// nextScheduledAt returns the runAt of the earliest job in the scheduled bucket
+func (q *Queue) nextScheduledAt() (time.Time, bool, error) {
+	var runAt time.Time
+	var found bool
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(schedPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		it.Seek([]byte(schedPrefix))
+		if !it.ValidForPrefix([]byte(schedPrefix)) {
+			return nil
+		}
+
+		nanos, _, err := parseSchedKey(it.Item().Key())
+		if err != nil {
+			return err
+		}
+
+		runAt = time.Unix(0, nanos)
+		found = true
+
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("cannot read next scheduled job: %v", err)
+	}
+
+	return runAt, found, nil
+}
+
+// promoteDueScheduledJobs moves every scheduled job whose runAt has passed into the pending
+// bucket, and returns how many were promoted
+func (q *Queue) promoteDueScheduledJobs() (int, error) {
+	now := time.Now()
+	promoted := 0
+
+	err := q.db.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(schedPrefix)
+		it := txn.NewIterator(opts)
+
+		var due []uint64
+		for it.Seek([]byte(schedPrefix)); it.ValidForPrefix([]byte(schedPrefix)); it.Next() {
+			nanos, id, err := parseSchedKey(it.Item().Key())
+			if err != nil {
+				return err
+			}
+			if time.Unix(0, nanos).After(now) {
+				break
+			}
+			due = append(due, id)
+		}
+		it.Close()
+
+		for _, id := range due {
+			item, err := txn.Get(jobKey(id))
+			if err != nil {
+				return err
+			}
+
+			var j *Job
+			if err := item.Value(func(val []byte) error {
+				decoded, err := decodeJob(val)
+				if err != nil {
+					return err
+				}
+				j = decoded
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			if err := txn.Delete(schedKey(j.NotBefore, j.ID)); err != nil {
+				return err
+			}
+
+			oldState := j.State
+			j.State = JobPending
+			j.NotBefore = time.Time{}
+			if err := q.putJob(txn, j, &oldState); err != nil {
+				return err
+			}
+
+			promoted++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot promote scheduled jobs: %v", err)
+	}
+
+	return promoted, nil
+}
+
+// dequeueJob pops the highest-priority pending job whose NotBefore has passed, breaking ties
+// by FIFO order. Jobs that are not yet due are skipped over without being removed.
+func (q *Queue) dequeueJob() (*Job, error) {
+	return q.dequeueJobOfType(nil)
+}
+
+// dequeueJobOfType behaves like dequeueJob, but additionally skips over jobs whose Type is
+// not in types. An empty types matches any job, same as dequeueJob.
+func (q *Queue) dequeueJobOfType(types []string) (*Job, error) {
+	var j *Job
+	now := time.Now()
+
+	err := q.db.Update(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(pendingPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(pendingPrefix)); it.ValidForPrefix([]byte(pendingPrefix)); it.Next() {
+			item := it.Item()
+			id, err := idFromPendingKey(item.Key())
+			if err != nil {
+				return err
+			}
+
+			jobItem, err := txn.Get(jobKey(id))
+			if err != nil {
+				return err
+			}
+
+			var candidate *Job
+			if err := jobItem.Value(func(val []byte) error {
+				decoded, err := decodeJob(val)
+				if err != nil {
+					return err
+				}
+				candidate = decoded
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			if candidate.NotBefore.After(now) {
+				continue
+			}
+			if !matchesType(candidate.Type, types) {
+				continue
+			}
+
+			if err := txn.Delete(item.KeyCopy(nil)); err != nil {
+				return err
+			}
+
+			oldState := candidate.State
+			candidate.State = JobRunning
+			if err := q.putJob(txn, candidate, &oldState); err != nil {
+				return err
+			}
+
+			j = candidate
+			return nil
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot dequeue job: %v", err)
+	}
+
+	return j, nil
+}
+
+// dequeueJobByID removes a specific pending job from the queue and marks it JobRunning, for
+// callers (such as assignJobs' WorkerSelector branch) that have already decided exactly which
+// job and processor to pair, rather than accepting whichever job a type filter would return
+// first. Returns nil if id is no longer pending, e.g. claimed by a concurrent dequeue.
+func (q *Queue) dequeueJobByID(id uint64) (*Job, error) {
+	var j *Job
+
+	err := q.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(jobKey(id))
+		if err != nil {
+			return err
+		}
+
+		var candidate *Job
+		if err := item.Value(func(val []byte) error {
+			decoded, err := decodeJob(val)
+			if err != nil {
+				return err
+			}
+			candidate = decoded
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if candidate.State != JobPending {
+			return nil
+		}
+
+		if err := txn.Delete(pendingKey(candidate.Priority, candidate.CreatedAt, candidate.ID)); err != nil {
+			return err
+		}
+
+		oldState := candidate.State
+		candidate.State = JobRunning
+		if err := q.putJob(txn, candidate, &oldState); err != nil {
+			return err
+		}
+
+		j = candidate
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot dequeue job %v: %v", id, err)
+	}
+
+	return j, nil
+}
+
+// matchesType reports whether jobType is acceptable given a processor's allowed types.
+// An empty allowed list matches every job type.
+func matchesType(jobType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	for _, t := range allowed {
+		if t == jobType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// peekPendingJobs returns every due pending job, in the same priority/FIFO order dequeueJob
+// uses, without removing them. assignJobs' WorkerSelector branch uses this to consider more
+// than just the head of the queue, since a lower-priority job further back may be the only
+// one any currently-free processor can actually handle.
+func (q *Queue) peekPendingJobs() ([]*Job, error) {
+	var jobs []*Job
+	now := time.Now()
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(pendingPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(pendingPrefix)); it.ValidForPrefix([]byte(pendingPrefix)); it.Next() {
+			id, err := idFromPendingKey(it.Item().Key())
+			if err != nil {
+				return err
+			}
+
+			jobItem, err := txn.Get(jobKey(id))
+			if err != nil {
+				return err
+			}
+
+			var candidate *Job
+			if err := jobItem.Value(func(val []byte) error {
+				decoded, err := decodeJob(val)
+				if err != nil {
+					return err
+				}
+				candidate = decoded
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			if candidate.NotBefore.After(now) {
+				continue
+			}
+
+			jobs = append(jobs, candidate)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot peek pending jobs: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// GetJob looks up a single job by ID, regardless of which bucket it currently lives in
+func (q *Queue) GetJob(id uint64) (*Job, error) {
+	var j *Job
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		item, err := txn.Get(jobKey(id))
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			decoded, err := decodeJob(val)
+			if err != nil {
+				return err
+			}
+			j = decoded
+			return nil
+		})
+	})
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot get job %v: %v", id, err)
+	}
+
+	return j, nil
+}
+
+// ListJobs returns up to limit jobs in the given state, skipping the first offset matches,
+// ordered by job ID. It scans the job bucket, so cost is proportional to the total job count
+// rather than to the number of jobs in state.
+func (q *Queue) ListJobs(state JobState, limit, offset int) ([]*Job, error) {
+	var jobs []*Job
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(jobPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		skipped := 0
+		for it.Seek([]byte(jobPrefix)); it.ValidForPrefix([]byte(jobPrefix)); it.Next() {
+			if len(jobs) >= limit {
+				return nil
+			}
+
+			var candidate *Job
+			if err := it.Item().Value(func(val []byte) error {
+				decoded, err := decodeJob(val)
+				if err != nil {
+					return err
+				}
+				candidate = decoded
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			if candidate.State != state {
+				continue
+			}
+			if skipped < offset {
+				skipped++
+				continue
+			}
+
+			jobs = append(jobs, candidate)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list jobs: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// CancelJob removes a pending or scheduled job before it runs, marking it JobCancelled.
+// For a job that is already running, this is a no-op success: Dispatcher.CancelJob is
+// responsible for actually interrupting it, and runJob persists JobCancelled itself once
+// the processor returns. It has no effect on a job that has already reached a terminal state.
+func (q *Queue) CancelJob(id uint64) error {
+	return q.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(jobKey(id))
+		if err != nil {
+			return err
+		}
+
+		var j *Job
+		if err := item.Value(func(val []byte) error {
+			decoded, err := decodeJob(val)
+			if err != nil {
+				return err
+			}
+			j = decoded
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		switch j.State {
+		case JobPending:
+			if err := txn.Delete(pendingKey(j.Priority, j.CreatedAt, j.ID)); err != nil {
+				return err
+			}
+		case JobScheduled:
+			if err := txn.Delete(schedKey(j.NotBefore, j.ID)); err != nil {
+				return err
+			}
+		case JobRunning:
+			return nil
+		default:
+			return fmt.Errorf("job %v is not pending, scheduled or running", id)
+		}
+
+		oldState := j.State
+		j.State = JobCancelled
+
+		return q.putJob(txn, j, &oldState)
+	})
+}
+
+// markJobCancelled persists the terminal JobCancelled state for a job that was running when
+// Dispatcher.CancelJob interrupted it
+func (q *Queue) markJobCancelled(id uint64) error {
+	return q.markJobDone(id, JobCancelled)
+}
+
+// DequeueJob pops the highest-priority due pending job, for callers (such as a remote
+// processor front end) that assign work outside of a Dispatcher's own loop
+func (q *Queue) DequeueJob() (*Job, error) {
+	return q.dequeueJob()
+}
+
+// Requeue resets a job to pending state, immediately eligible for dequeue. Used to recover
+// a job whose external claim (e.g. a RemoteProcessor lease) expired without a result.
+func (q *Queue) Requeue(id uint64) error {
+	return q.requeueJob(id)
+}
+
+// CompleteJob marks a job as having run successfully
+func (q *Queue) CompleteJob(id uint64) error {
+	return q.markJobDone(id, JobComplete)
+}
+
+// FailJob records that running j produced runErr, then either reschedules it for another
+// attempt per rp or, once its retry budget is exhausted, moves it to the dead-letter bucket
+func (q *Queue) FailJob(j *Job, runErr error, rp RetryPolicy) error {
+	if j.Attempt < maxRetriesFor(j, rp) {
+		return q.retryJob(j.ID, time.Now().Add(rp.Delay(j.Attempt+1, runErr)))
+	}
+
+	return q.markJobDead(j.ID)
+}
+
+// markJobDone transitions a job to a terminal state and persists it
+func (q *Queue) markJobDone(id uint64, state JobState) error {
+	return q.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(jobKey(id))
+		if err != nil {
+			return err
+		}
+
+		var j *Job
+		if err := item.Value(func(val []byte) error {
+			decoded, err := decodeJob(val)
+			if err != nil {
+				return err
+			}
+			j = decoded
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		oldState := j.State
+		j.State = state
+
+		return q.putJob(txn, j, &oldState)
+	})
+}
+
+// retryJob increments a job's attempt counter, schedules it for dequeue at notBefore and
+// re-inserts it into the pending bucket
+func (q *Queue) retryJob(id uint64, notBefore time.Time) error {
+	return q.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(jobKey(id))
+		if err != nil {
+			return err
+		}
+
+		var j *Job
+		if err := item.Value(func(val []byte) error {
+			decoded, err := decodeJob(val)
+			if err != nil {
+				return err
+			}
+			j = decoded
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		oldState := j.State
+		j.State = JobPending
+		j.Attempt++
+		j.NotBefore = notBefore
+
+		return q.putJob(txn, j, &oldState)
+	})
+}
+
+// requeueJob resets a job to pending state, immediately eligible for dequeue. Used to return
+// an in-flight job to the queue when its processor was canceled rather than having failed.
+func (q *Queue) requeueJob(id uint64) error {
+	return q.db.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(jobKey(id))
+		if err != nil {
+			return err
+		}
+
+		var j *Job
+		if err := item.Value(func(val []byte) error {
+			decoded, err := decodeJob(val)
+			if err != nil {
+				return err
+			}
+			j = decoded
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		oldState := j.State
+		j.State = JobPending
+		j.NotBefore = time.Time{}
+
+		return q.putJob(txn, j, &oldState)
+	})
+}
+
+// markJobDead moves a job that exhausted its retries into the dead-letter bucket
+func (q *Queue) markJobDead(id uint64) error {
+	return q.markJobDone(id, JobDead)
+}
+
+// GetDeadJobs returns all jobs currently in the dead-letter bucket, oldest first
+func (q *Queue) GetDeadJobs() ([]*Job, error) {
+	var jobs []*Job
+
+	err := q.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = []byte(deadPrefix)
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek([]byte(deadPrefix)); it.ValidForPrefix([]byte(deadPrefix)); it.Next() {
+			id, err := idFromPendingKey(it.Item().Key())
+			if err != nil {
+				return err
+			}
+
+			jobItem, err := txn.Get(jobKey(id))
+			if err != nil {
+				return err
+			}
+
+			if err := jobItem.Value(func(val []byte) error {
+				decoded, err := decodeJob(val)
+				if err != nil {
+					return err
+				}
+				jobs = append(jobs, decoded)
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get dead jobs: %v", err)
+	}
+
+	return jobs, nil
+}
+
+// pendingKey encodes a pending-bucket index key as pending|<inverted priority>|<timestamp>|<id>
+// so that a forward BadgerDB scan yields jobs highest-priority first, FIFO within a priority
+func pendingKey(priority int, createdAt time.Time, id uint64) []byte {
+	key := make([]byte, 0, len(pendingPrefix)+8+8+8)
+	key = append(key, []byte(pendingPrefix)...)
+
+	// Map priority to a uint64 so that ascending byte order yields descending priority
+	// order, across the full signed int range (not just non-negative priorities): flip the
+	// sign bit to get an order-preserving unsigned encoding, then bitwise-NOT to reverse it.
+	var pbuf [8]byte
+	ordinal := uint64(int64(priority)) ^ (1 << 63)
+	binary.BigEndian.PutUint64(pbuf[:], ^ordinal)
+	key = append(key, pbuf[:]...)
+
+	var tbuf [8]byte
+	binary.BigEndian.PutUint64(tbuf[:], uint64(createdAt.UnixNano()))
+	key = append(key, tbuf[:]...)
+
+	var ibuf [8]byte
+	binary.BigEndian.PutUint64(ibuf[:], id)
+	key = append(key, ibuf[:]...)
+
+	return key
+}
+
+// idFromPendingKey extracts the job id suffix from a pending-bucket index key
+func idFromPendingKey(key []byte) (uint64, error) {
+	if len(key) < 8 {
+		return 0, fmt.Errorf("malformed pending key %x", key)
+	}
+
+	return binary.BigEndian.Uint64(key[len(key)-8:]), nil
+}
+
+// schedKey encodes a scheduled-bucket index key as sched|<unix-nano runAt>|<id>, so a forward
+// BadgerDB scan yields scheduled jobs in runAt order
+func schedKey(runAt time.Time, id uint64) []byte {
+	key := make([]byte, 0, len(schedPrefix)+8+8)
+	key = append(key, []byte(schedPrefix)...)
+
+	var tbuf [8]byte
+	binary.BigEndian.PutUint64(tbuf[:], uint64(runAt.UnixNano()))
+	key = append(key, tbuf[:]...)
+
+	var ibuf [8]byte
+	binary.BigEndian.PutUint64(ibuf[:], id)
+	key = append(key, ibuf[:]...)
+
+	return key
+}
+
+// parseSchedKey extracts the runAt (unix nano) and job id from a scheduled-bucket index key
+func parseSchedKey(key []byte) (int64, uint64, error) {
+	if len(key) < 16 {
+		return 0, 0, fmt.Errorf("malformed scheduled key %x", key)
+	}
+
+	nanos := int64(binary.BigEndian.Uint64(key[len(key)-16 : len(key)-8]))
+	id := binary.BigEndian.Uint64(key[len(key)-8:])
+
+	return nanos, id, nil
+}
+
+// deadKey encodes a dead-letter bucket index key as dead|<timestamp>|<id>
+func deadKey(deadAt time.Time, id uint64) []byte {
+	key := make([]byte, 0, len(deadPrefix)+8+8)
+	key = append(key, []byte(deadPrefix)...)
+
+	var tbuf [8]byte
+	binary.BigEndian.PutUint64(tbuf[:], uint64(deadAt.UnixNano()))
+	key = append(key, tbuf[:]...)
+
+	var ibuf [8]byte
+	binary.BigEndian.PutUint64(ibuf[:], id)
+	key = append(key, ibuf[:]...)
+
+	return key
+}
+
+func jobKey(id uint64) []byte {
+	key := make([]byte, 0, len(jobPrefix)+8)
+	key = append(key, []byte(jobPrefix)...)
+
+	var ibuf [8]byte
+	binary.BigEndian.PutUint64(ibuf[:], id)
+
+	return append(key, ibuf[:]...)
+}
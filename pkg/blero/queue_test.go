@@ -0,0 +1,114 @@
+package blero
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPendingKeyPriorityOrdering(t *testing.T) {
+	now := time.Now()
+
+	priorities := []int{5, 1, 0, -1, -100}
+	keys := make([][]byte, len(priorities))
+	for i, p := range priorities {
+		keys[i] = pendingKey(p, now, uint64(i))
+	}
+
+	for i := 0; i < len(keys)-1; i++ {
+		if bytes.Compare(keys[i], keys[i+1]) >= 0 {
+			t.Fatalf("expected pendingKey(priority=%d) < pendingKey(priority=%d), got %x >= %x",
+				priorities[i], priorities[i+1], keys[i], keys[i+1])
+		}
+	}
+}
+
+func TestPromoteDueScheduledJobsOnlyPromotesPastJobs(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	due, err := q.EnqueueJobAt([]byte("due"), time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("EnqueueJobAt(due): %v", err)
+	}
+	notYetDue, err := q.EnqueueJobAt([]byte("not-due"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("EnqueueJobAt(notYetDue): %v", err)
+	}
+
+	n, err := q.promoteDueScheduledJobs()
+	if err != nil {
+		t.Fatalf("promoteDueScheduledJobs: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 job promoted, got %d", n)
+	}
+
+	gotDue, err := q.GetJob(due.ID)
+	if err != nil {
+		t.Fatalf("GetJob(due): %v", err)
+	}
+	if gotDue.State != JobPending {
+		t.Fatalf("expected due job to become JobPending, got %v", gotDue.State)
+	}
+
+	gotNotYetDue, err := q.GetJob(notYetDue.ID)
+	if err != nil {
+		t.Fatalf("GetJob(notYetDue): %v", err)
+	}
+	if gotNotYetDue.State != JobScheduled {
+		t.Fatalf("expected not-yet-due job to remain JobScheduled, got %v", gotNotYetDue.State)
+	}
+}
+
+func TestStateCountTracksTransitions(t *testing.T) {
+	q, err := NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	assertCount := func(state JobState, want int64) {
+		t.Helper()
+		got, err := q.StateCount(state)
+		if err != nil {
+			t.Fatalf("StateCount(%v): %v", state, err)
+		}
+		if got != want {
+			t.Fatalf("StateCount(%v) = %d, want %d", state, got, want)
+		}
+	}
+
+	assertCount(JobPending, 1)
+	assertCount(JobComplete, 0)
+
+	if _, err := q.dequeueJob(); err != nil {
+		t.Fatalf("dequeueJob: %v", err)
+	}
+	assertCount(JobPending, 0)
+	assertCount(JobRunning, 1)
+
+	if err := q.CompleteJob(j.ID); err != nil {
+		t.Fatalf("CompleteJob: %v", err)
+	}
+	assertCount(JobRunning, 0)
+	assertCount(JobComplete, 1)
+}
+
+func TestPendingKeyFIFOWithinPriority(t *testing.T) {
+	priority := 3
+	earlier := pendingKey(priority, time.Unix(0, 100), 1)
+	later := pendingKey(priority, time.Unix(0, 200), 2)
+
+	if bytes.Compare(earlier, later) >= 0 {
+		t.Fatalf("expected earlier-enqueued job's key to sort first, got %x >= %x", earlier, later)
+	}
+}
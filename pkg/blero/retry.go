@@ -0,0 +1,39 @@
+package blero
+
+import "time"
+
+// RetryPolicy controls how the Dispatcher retries jobs whose Processor returned an error
+type RetryPolicy struct {
+	// MaxRetries is the number of attempts after the first failure before a job is moved
+	// to the dead-letter queue. Zero disables retries.
+	MaxRetries int
+	// Delay computes how long to wait before the given attempt is retried
+	Delay func(attempt int, err error) time.Duration
+}
+
+// DefaultRetryPolicy retries a job up to 5 times with an exponential backoff
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 5,
+	Delay:      ExponentialBackoff(time.Second),
+}
+
+// ExponentialBackoff returns a RetryPolicy.Delay function that doubles base on every attempt
+func ExponentialBackoff(base time.Duration) func(attempt int, err error) time.Duration {
+	return func(attempt int, err error) time.Duration {
+		if attempt < 1 {
+			attempt = 1
+		}
+
+		return base * time.Duration(1<<uint(attempt-1))
+	}
+}
+
+// maxRetriesFor returns the retry budget to apply to j: its own MaxRetries if set,
+// otherwise the dispatcher-wide default
+func maxRetriesFor(j *Job, rp RetryPolicy) int {
+	if j.MaxRetries > 0 {
+		return j.MaxRetries
+	}
+
+	return rp.MaxRetries
+}
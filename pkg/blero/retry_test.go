@@ -0,0 +1,37 @@
+package blero
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponentialBackoffDoublesPerAttempt(t *testing.T) {
+	delay := ExponentialBackoff(time.Second)
+
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 0, want: time.Second}, // clamped to attempt 1
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+	}
+
+	for _, c := range cases {
+		if got := delay(c.attempt, nil); got != c.want {
+			t.Errorf("delay(%d) = %v, want %v", c.attempt, got, c.want)
+		}
+	}
+}
+
+func TestMaxRetriesForPrefersJobOverride(t *testing.T) {
+	rp := RetryPolicy{MaxRetries: 5}
+
+	if got := maxRetriesFor(&Job{MaxRetries: 2}, rp); got != 2 {
+		t.Errorf("expected job-level MaxRetries to win, got %d", got)
+	}
+	if got := maxRetriesFor(&Job{}, rp); got != 5 {
+		t.Errorf("expected policy default when job doesn't override, got %d", got)
+	}
+}
@@ -0,0 +1,64 @@
+package blero
+
+// WorkerSelector decides which registered Processor should run a given Job, letting callers
+// build heterogeneous pools where only some processors are able to (or preferred to) handle
+// a particular job.
+type WorkerSelector interface {
+	// Ok reports whether p is able to run j at all
+	Ok(j *Job, p Processor) (bool, error)
+	// Cmp reports whether a is a better fit for j than b. It is only called with processors
+	// that already returned true from Ok.
+	Cmp(j *Job, a, b Processor) (bool, error)
+}
+
+// SetSelector installs a WorkerSelector used by assignJobs to pick the best processor for
+// each pending job. Passing nil restores the default "first free processor wins" behavior.
+func (d *Dispatcher) SetSelector(s WorkerSelector) {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	d.selector = s
+}
+
+// ProcessorTags returns the capability tags a processor was registered with, or nil if it
+// was registered with RegisterProcessor or the tags were empty.
+func (d *Dispatcher) ProcessorTags(pID int) []string {
+	d.dispatchL.Lock()
+	defer d.dispatchL.Unlock()
+
+	return d.processorTags[pID]
+}
+
+// bestProcessor returns the pID among candidates that the installed selector prefers for j,
+// or 0 if none of them can run it. NOT THREAD SAFE !! only call with dispatchL held.
+func (d *Dispatcher) bestProcessor(j *Job, candidates []int) (int, error) {
+	var bestID int
+	var best Processor
+
+	for _, pID := range candidates {
+		p := d.processors[pID]
+
+		ok, err := d.selector.Ok(j, p)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			continue
+		}
+
+		if best == nil {
+			bestID, best = pID, p
+			continue
+		}
+
+		prefer, err := d.selector.Cmp(j, p, best)
+		if err != nil {
+			return 0, err
+		}
+		if prefer {
+			bestID, best = pID, p
+		}
+	}
+
+	return bestID, nil
+}
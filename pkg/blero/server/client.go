@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/timbury/goblero/pkg/blero"
+)
+
+// pollInterval is how long RemoteProcessor waits between unsuccessful polls of /jobs/next
+const pollInterval = time.Second
+
+// RemoteProcessor polls a Server's /jobs/next endpoint for work, runs a user-supplied
+// handler on each job it claims, and reports the outcome back via /jobs/{id}/result.
+// It lets a process without direct access to the BadgerDB-backed Queue still run jobs,
+// e.g. a worker deployed separately from the Server.
+type RemoteProcessor struct {
+	baseURL string
+	handler func(ctx context.Context, j *blero.Job) error
+	client  *http.Client
+}
+
+// NewRemoteProcessor creates a RemoteProcessor that polls baseURL (a running Server's
+// address, e.g. "http://localhost:8080") and runs handler for every job it claims
+func NewRemoteProcessor(baseURL string, handler func(ctx context.Context, j *blero.Job) error) *RemoteProcessor {
+	return &RemoteProcessor{
+		baseURL: baseURL,
+		handler: handler,
+		client:  http.DefaultClient,
+	}
+}
+
+// Run polls for jobs and runs them until ctx is canceled
+func (r *RemoteProcessor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if err := r.pollOnce(ctx); err != nil {
+				fmt.Printf("RemoteProcessor: poll failed: %v\n", err)
+			}
+		}
+	}
+}
+
+// pollOnce claims at most one job and runs it to completion, reporting the result back
+func (r *RemoteProcessor) pollOnce(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.baseURL+"/jobs/next", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status from /jobs/next: %v", resp.Status)
+	}
+
+	var claimed claimedJob
+	if err := json.NewDecoder(resp.Body).Decode(&claimed); err != nil {
+		return fmt.Errorf("cannot decode claimed job: %v", err)
+	}
+
+	runErr := r.handler(ctx, claimed.Job)
+
+	return r.reportResult(ctx, claimed.Job.ID, claimed.Token, runErr)
+}
+
+func (r *RemoteProcessor) reportResult(ctx context.Context, id uint64, token string, runErr error) error {
+	res := jobResult{Success: runErr == nil, Token: token}
+	if runErr != nil {
+		res.Error = runErr.Error()
+	}
+
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/jobs/%d/result", r.baseURL, id)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("unexpected status from /jobs/%d/result: %v", id, resp.Status)
+	}
+
+	return nil
+}
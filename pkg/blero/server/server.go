@@ -0,0 +1,456 @@
+// Package server exposes a blero Queue and Dispatcher over HTTP, turning blero into a
+// control plane that remote workers and external tools can enqueue to, inspect and poll
+// without linking against the blero package directly.
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/timbury/goblero/pkg/blero"
+)
+
+// claimTTL bounds how long a job claimed via /jobs/next may run before the Server assumes
+// the remote worker died and requeues it
+const claimTTL = 5 * time.Minute
+
+// reapInterval is how often Start polls for claims that have exceeded claimTTL without a
+// matching POST /jobs/{id}/result
+const reapInterval = claimTTL / 2
+
+// claim is a lease on a job handed out by /jobs/next. token fences it: a POST
+// /jobs/{id}/result must present the token of the current claim, not just any claim that ever
+// existed for id, so a stale worker whose claim was reaped and reassigned can't clobber the
+// result of whoever claimed the job next.
+type claim struct {
+	token    string
+	deadline time.Time
+}
+
+// Server serves a Queue (and optionally a Dispatcher, for /stats) over HTTP
+type Server struct {
+	q *blero.Queue
+	d *blero.Dispatcher
+
+	claimsL sync.Mutex
+	claims  map[uint64]claim
+}
+
+// New creates a Server around q. d may be nil; when set, its per-processor stats are
+// included in GET /stats.
+func New(q *blero.Queue, d *blero.Dispatcher) *Server {
+	return &Server{
+		q:      q,
+		d:      d,
+		claims: make(map[uint64]claim),
+	}
+}
+
+// Handler returns the http.Handler implementing the control plane's routes
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/jobs", s.handleJobsCollection)
+	mux.HandleFunc("/jobs/next", s.handleJobsNext)
+	mux.HandleFunc("/jobs/", s.handleJobsItem)
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/metrics", s.handleMetrics)
+
+	return mux
+}
+
+// Start runs ReapExpiredClaims on a reapInterval ticker until ctx is done. Callers that
+// expose handleJobsNext to RemoteProcessors should run this alongside Handler, e.g.
+// go s.Start(ctx), so a claimed job whose remote worker crashes or partitions away doesn't
+// stall forever.
+func (s *Server) Start(ctx context.Context) {
+	ticker := time.NewTicker(reapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.ReapExpiredClaims()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ReapExpiredClaims requeues any job claimed via /jobs/next whose claimTTL has elapsed
+// without a matching POST /jobs/{id}/result. Call it periodically (e.g. from a ticker, or
+// via Start).
+func (s *Server) ReapExpiredClaims() {
+	now := time.Now()
+
+	s.claimsL.Lock()
+	var expired []uint64
+	for id, c := range s.claims {
+		if now.After(c.deadline) {
+			expired = append(expired, id)
+			delete(s.claims, id)
+		}
+	}
+	s.claimsL.Unlock()
+
+	for _, id := range expired {
+		if err := s.q.Requeue(id); err != nil {
+			// already reported, completed or removed elsewhere; nothing to do
+			continue
+		}
+	}
+}
+
+func (s *Server) handleJobsCollection(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.enqueueJob(w, r)
+	case http.MethodGet:
+		s.listJobs(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) enqueueJob(w http.ResponseWriter, r *http.Request) {
+	data, err := readAll(r)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot read body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	opts := blero.JobOptions{Priority: blero.DefaultPriority}
+	if v := r.URL.Query().Get("priority"); v != "" {
+		p, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid priority", http.StatusBadRequest)
+			return
+		}
+		opts.Priority = p
+	}
+	if v := r.URL.Query().Get("delay"); v != "" {
+		delay, err := time.ParseDuration(v)
+		if err != nil {
+			http.Error(w, "invalid delay", http.StatusBadRequest)
+			return
+		}
+		opts.Delay = delay
+	}
+	if v := r.URL.Query().Get("max_retries"); v != "" {
+		mr, err := strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid max_retries", http.StatusBadRequest)
+			return
+		}
+		opts.MaxRetries = mr
+	}
+
+	j, err := s.q.EnqueueJobWithOptions(data, opts)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot enqueue job: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, j)
+}
+
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	state, err := parseState(r.URL.Query().Get("state"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	offset := 0
+	if v := r.URL.Query().Get("offset"); v != "" {
+		offset, err = strconv.Atoi(v)
+		if err != nil {
+			http.Error(w, "invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	jobs, err := s.q.ListJobs(state, limit, offset)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot list jobs: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) handleJobsItem(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	parts := strings.SplitN(rest, "/", 2)
+
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "result" && r.Method == http.MethodPost {
+		s.reportResult(w, r, id)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getJob(w, id)
+	case http.MethodDelete:
+		s.cancelJob(w, id)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) getJob(w http.ResponseWriter, id uint64) {
+	j, err := s.q.GetJob(id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot get job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, j)
+}
+
+// cancelJob handles DELETE /jobs/{id}. For a pending or scheduled job it is removed
+// immediately; for a currently-running job, s.d.CancelJob interrupts its processor and
+// q.CancelJob is then a no-op success, since the job's terminal JobCancelled state is
+// persisted asynchronously by the Dispatcher once the processor actually returns.
+func (s *Server) cancelJob(w http.ResponseWriter, id uint64) {
+	if s.d != nil {
+		s.d.CancelJob(id)
+	}
+
+	if err := s.q.CancelJob(id); err != nil {
+		http.Error(w, fmt.Sprintf("cannot cancel job: %v", err), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// claimedJob is the response body for GET /jobs/next: the claimed job plus the fencing token
+// that must be echoed back on POST /jobs/{id}/result.
+type claimedJob struct {
+	Job   *blero.Job `json:"job"`
+	Token string     `json:"token"`
+}
+
+// handleJobsNext lets a RemoteProcessor claim the next pending job. It returns 204 No
+// Content if none is available.
+func (s *Server) handleJobsNext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	j, err := s.q.DequeueJob()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot dequeue job: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if j == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	token, err := newClaimToken()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot generate claim token: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	s.claimsL.Lock()
+	s.claims[j.ID] = claim{token: token, deadline: time.Now().Add(claimTTL)}
+	s.claimsL.Unlock()
+
+	writeJSON(w, http.StatusOK, claimedJob{Job: j, Token: token})
+}
+
+// newClaimToken returns a random token fencing one claim of a job from the next
+func newClaimToken() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("cannot generate claim token: %v", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+type jobResult struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Token   string `json:"token"`
+}
+
+func (s *Server) reportResult(w http.ResponseWriter, r *http.Request, id uint64) {
+	var res jobResult
+	if err := json.NewDecoder(r.Body).Decode(&res); err != nil {
+		http.Error(w, fmt.Sprintf("cannot decode result: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	s.claimsL.Lock()
+	c, claimed := s.claims[id]
+	if claimed && c.token == res.Token {
+		delete(s.claims, id)
+	}
+	s.claimsL.Unlock()
+
+	if !claimed {
+		http.Error(w, "job is not claimed", http.StatusConflict)
+		return
+	}
+	if c.token != res.Token {
+		http.Error(w, "stale claim token, job was reclaimed", http.StatusConflict)
+		return
+	}
+
+	if res.Success {
+		if err := s.q.CompleteJob(id); err != nil {
+			http.Error(w, fmt.Sprintf("cannot complete job: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	j, err := s.q.GetJob(id)
+	if err != nil || j == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	if err := s.q.FailJob(j, fmt.Errorf("%s", res.Error), blero.DefaultRetryPolicy); err != nil {
+		http.Error(w, fmt.Sprintf("cannot fail job: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Stats summarizes queue and processor state for GET /stats and GET /metrics
+type Stats struct {
+	Pending   int `json:"pending"`
+	Complete  int `json:"complete"`
+	Failed    int `json:"failed"`
+	Dead      int `json:"dead"`
+	Scheduled int `json:"scheduled"`
+
+	// Processors is per-processor lifetime throughput, keyed by processor ID. It is omitted
+	// when the Server was created with a nil Dispatcher.
+	Processors map[int]blero.ProcessorStats `json:"processors,omitempty"`
+}
+
+// stats reads Queue.StateCount, an O(1) per-state counter, rather than ListJobs, so that
+// /metrics being scraped every few seconds doesn't cost a full job-keyspace scan per call.
+func (s *Server) stats() (Stats, error) {
+	var st Stats
+
+	for state, dst := range map[blero.JobState]*int{
+		blero.JobPending:   &st.Pending,
+		blero.JobComplete:  &st.Complete,
+		blero.JobFailed:    &st.Failed,
+		blero.JobDead:      &st.Dead,
+		blero.JobScheduled: &st.Scheduled,
+	} {
+		count, err := s.q.StateCount(state)
+		if err != nil {
+			return Stats{}, err
+		}
+		*dst = int(count)
+	}
+
+	if s.d != nil {
+		st.Processors = s.d.ProcessorStats()
+	}
+
+	return st, nil
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	st, err := s.stats()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot compute stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, st)
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	st, err := s.stats()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot compute stats: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP blero_jobs Number of jobs per state\n")
+	fmt.Fprintf(w, "# TYPE blero_jobs gauge\n")
+	fmt.Fprintf(w, "blero_jobs{state=\"pending\"} %d\n", st.Pending)
+	fmt.Fprintf(w, "blero_jobs{state=\"complete\"} %d\n", st.Complete)
+	fmt.Fprintf(w, "blero_jobs{state=\"failed\"} %d\n", st.Failed)
+	fmt.Fprintf(w, "blero_jobs{state=\"dead\"} %d\n", st.Dead)
+	fmt.Fprintf(w, "blero_jobs{state=\"scheduled\"} %d\n", st.Scheduled)
+
+	if len(st.Processors) > 0 {
+		fmt.Fprintf(w, "# HELP blero_processor_jobs Number of jobs completed or failed per processor\n")
+		fmt.Fprintf(w, "# TYPE blero_processor_jobs counter\n")
+		for pID, ps := range st.Processors {
+			fmt.Fprintf(w, "blero_processor_jobs{processor=\"%d\",outcome=\"complete\"} %d\n", pID, ps.Completed)
+			fmt.Fprintf(w, "blero_processor_jobs{processor=\"%d\",outcome=\"failed\"} %d\n", pID, ps.Failed)
+		}
+	}
+}
+
+func parseState(v string) (blero.JobState, error) {
+	switch v {
+	case "", "pending":
+		return blero.JobPending, nil
+	case "complete":
+		return blero.JobComplete, nil
+	case "failed":
+		return blero.JobFailed, nil
+	case "dead":
+		return blero.JobDead, nil
+	case "scheduled":
+		return blero.JobScheduled, nil
+	default:
+		return 0, fmt.Errorf("unknown state %q", v)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func readAll(r *http.Request) ([]byte, error) {
+	defer r.Body.Close()
+	return io.ReadAll(r.Body)
+}
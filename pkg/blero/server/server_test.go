@@ -0,0 +1,211 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/timbury/goblero/pkg/blero"
+)
+
+func TestStatsReflectsEnqueueAndCancel(t *testing.T) {
+	q, err := blero.NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	s := New(q, nil)
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	st, err := s.stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if st.Pending != 1 {
+		t.Fatalf("expected 1 pending job, got %d", st.Pending)
+	}
+
+	rr := httptest.NewRecorder()
+	s.cancelJob(rr, j.ID)
+	if rr.Code != 204 {
+		t.Fatalf("expected 204 cancelling a pending job, got %d", rr.Code)
+	}
+
+	st, err = s.stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if st.Pending != 0 {
+		t.Fatalf("expected 0 pending jobs after cancel, got %d", st.Pending)
+	}
+}
+
+func TestStatsIncludesProcessorThroughputWhenDispatcherSet(t *testing.T) {
+	q, err := blero.NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	d := blero.NewDispatcher()
+	d.StartLoop(q)
+	defer d.StopLoop()
+
+	pID := d.RegisterProcessor(noopProcessor{})
+
+	s := New(q, d)
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	var got *blero.Job
+	for i := 0; i < 200; i++ {
+		got, err = q.GetJob(j.ID)
+		if err != nil {
+			t.Fatalf("GetJob: %v", err)
+		}
+		if got.State == blero.JobComplete {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got.State != blero.JobComplete {
+		t.Fatalf("expected job to reach JobComplete, got %v", got.State)
+	}
+
+	st, err := s.stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if got := st.Processors[pID]; got.Completed != 1 {
+		t.Fatalf("expected processor %d to show 1 completed job, got %+v", pID, got)
+	}
+}
+
+func TestStatsOmitsProcessorsWithoutDispatcher(t *testing.T) {
+	q, err := blero.NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	s := New(q, nil)
+
+	st, err := s.stats()
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if st.Processors != nil {
+		t.Fatalf("expected nil Processors without a Dispatcher, got %v", st.Processors)
+	}
+}
+
+// noopProcessor is a minimal blero.Processor that always succeeds immediately
+type noopProcessor struct{}
+
+func (noopProcessor) Run(ctx context.Context, j *blero.Job) error { return nil }
+
+func TestHandleJobsNextReturnsTokenAndReportResultRejectsMismatch(t *testing.T) {
+	q, err := blero.NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	s := New(q, nil)
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+
+	nextReq := httptest.NewRequest(http.MethodGet, "/jobs/next", nil)
+	nextRR := httptest.NewRecorder()
+	s.handleJobsNext(nextRR, nextReq)
+	if nextRR.Code != http.StatusOK {
+		t.Fatalf("expected 200 from /jobs/next, got %d", nextRR.Code)
+	}
+
+	var claimed claimedJob
+	if err := json.NewDecoder(nextRR.Body).Decode(&claimed); err != nil {
+		t.Fatalf("decode claimedJob: %v", err)
+	}
+	if claimed.Job.ID != j.ID || claimed.Token == "" {
+		t.Fatalf("expected claimedJob for job %d with a non-empty token, got %+v", j.ID, claimed)
+	}
+
+	badBody, _ := json.Marshal(jobResult{Success: true, Token: "wrong-token"})
+	badReq := httptest.NewRequest(http.MethodPost, "/jobs/1/result", bytes.NewReader(badBody))
+	badRR := httptest.NewRecorder()
+	s.reportResult(badRR, badReq, j.ID)
+	if badRR.Code != http.StatusConflict {
+		t.Fatalf("expected 409 reporting a result with a stale/mismatched token, got %d", badRR.Code)
+	}
+
+	got, err := q.GetJob(j.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.State != blero.JobRunning {
+		t.Fatalf("expected job to remain JobRunning after a rejected token, got %v", got.State)
+	}
+
+	goodBody, _ := json.Marshal(jobResult{Success: true, Token: claimed.Token})
+	goodReq := httptest.NewRequest(http.MethodPost, "/jobs/1/result", bytes.NewReader(goodBody))
+	goodRR := httptest.NewRecorder()
+	s.reportResult(goodRR, goodReq, j.ID)
+	if goodRR.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 reporting a result with the correct token, got %d", goodRR.Code)
+	}
+
+	got, err = q.GetJob(j.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.State != blero.JobComplete {
+		t.Fatalf("expected job to complete after a correctly-tokened result, got %v", got.State)
+	}
+}
+
+func TestCancelJobOnRunningJobNoOpsWithoutDispatcher(t *testing.T) {
+	q, err := blero.NewQueue(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewQueue: %v", err)
+	}
+	defer q.Close()
+
+	s := New(q, nil)
+
+	j, err := q.EnqueueJob([]byte("payload"))
+	if err != nil {
+		t.Fatalf("EnqueueJob: %v", err)
+	}
+	if _, err := q.DequeueJob(); err != nil {
+		t.Fatalf("DequeueJob: %v", err)
+	}
+
+	rr := httptest.NewRecorder()
+	s.cancelJob(rr, j.ID)
+	if rr.Code != 204 {
+		t.Fatalf("expected cancelling a running job to still report success, got %d", rr.Code)
+	}
+
+	got, err := q.GetJob(j.ID)
+	if err != nil {
+		t.Fatalf("GetJob: %v", err)
+	}
+	if got.State != blero.JobRunning {
+		t.Fatalf("expected job to remain JobRunning until its processor returns, got %v", got.State)
+	}
+}